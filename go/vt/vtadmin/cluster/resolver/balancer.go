@@ -0,0 +1,312 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolver
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/connectivity"
+	grpcresolver "google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+// maxSourceWeightRepeat bounds how many times a single SubConn is repeated
+// in a picker's candidate list for a given SourceWeightAttributeKey value,
+// so a misconfigured or malicious weight can't make regeneratePicker
+// allocate an unreasonably large slice.
+const maxSourceWeightRepeat = 100
+
+// LocalityBalancerName is the name under which the locality-aware balancer
+// policy is registered with grpc-core, selectable via Options.BalancerPolicy
+// as LocalityBalancer.
+const LocalityBalancerName = "vtadmin_locality"
+
+// CellAttributeKey is the HostInfo.Attrs / BalancerAttributes key a
+// discovery.Discovery implementation should set (via
+// DiscoverVtctldAddrsWithMetadata / DiscoverVTGateAddrsWithMetadata) to
+// advertise an address's cell, so the vtadmin_locality balancer can prefer
+// SubConns in the ClientConn's preferred cell.
+const CellAttributeKey = "cell"
+
+func init() {
+	balancer.Register(&localityBalancerBuilder{})
+}
+
+// localityBalancerConfig is the vtadmin_locality entry of a
+// loadBalancingConfig, carrying the preferred cell for a single ClientConn.
+// builder.build encodes Options.PreferredCell into it per-resolver (see
+// resolver.go), rather than setting a process-wide value: grpc-core
+// registers balancer policies by name once, globally, so a package-level
+// "preferred cell" var would be shared (and clobbered) across every vtadmin
+// cluster's resolver using this policy.
+type localityBalancerConfig struct {
+	serviceconfig.LoadBalancingConfig `json:"-"`
+
+	PreferredCell string `json:"preferredCell,omitempty"`
+}
+
+// localityBalancerBuilder implements balancer.Builder and balancer.ConfigParser
+// for the vtadmin_locality policy.
+type localityBalancerBuilder struct{}
+
+// Build is part of the balancer.Builder interface.
+func (*localityBalancerBuilder) Build(cc balancer.ClientConn, _ balancer.BuildOptions) balancer.Balancer {
+	return &localityBalancer{
+		cc:       cc,
+		subConns: grpcresolver.NewAddressMap(),
+		scStates: make(map[balancer.SubConn]connectivity.State),
+	}
+}
+
+// Name is part of the balancer.Builder interface.
+func (*localityBalancerBuilder) Name() string { return LocalityBalancerName }
+
+// ParseConfig is part of the balancer.ConfigParser interface. It is
+// consulted by grpc-core's service config parsing, letting a ClientConn's
+// preferred cell flow in per-ClientConn, rather than through global state.
+func (*localityBalancerBuilder) ParseConfig(js json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	var cfg localityBalancerConfig
+	if err := json.Unmarshal(js, &cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// subConnEntry pairs a SubConn with the grpcresolver.Address it was created
+// from, so regeneratePicker can read that address's cell attributes without
+// a second, separately-ordered lookup.
+type subConnEntry struct {
+	sc   balancer.SubConn
+	addr grpcresolver.Address
+}
+
+// localityBalancer prefers SubConns whose CellAttributeKey BalancerAttribute
+// matches preferredCell, falling back to round_robin across the full ready
+// set when no SubConn matches (or preferredCell is unset). preferredCell is
+// instance state scoped to this balancer's ClientConn, set from
+// localityBalancerConfig by UpdateClientConnState rather than a package var,
+// so distinct vtadmin clusters each get their own preferred cell.
+type localityBalancer struct {
+	cc balancer.ClientConn
+
+	mu            sync.Mutex
+	preferredCell string
+	// subConns is a grpcresolver.AddressMap of *subConnEntry, keyed on Addr
+	// and ServerName (with Attributes compared by value) rather than a plain
+	// map[grpcresolver.Address]: resolve() allocates a fresh *attributes.Attributes
+	// for every address on every resolve (see attributesFromHostInfo), so a
+	// map keyed on the raw Address struct would compare those pointers by
+	// identity and never match an existing entry, tearing down and
+	// recreating every SubConn on each resolve.
+	subConns *grpcresolver.AddressMap
+	scStates map[balancer.SubConn]connectivity.State
+}
+
+// UpdateClientConnState is part of the balancer.Balancer interface.
+func (b *localityBalancer) UpdateClientConnState(s balancer.ClientConnState) error {
+	b.mu.Lock()
+
+	if cfg, ok := s.BalancerConfig.(localityBalancerConfig); ok {
+		b.preferredCell = cfg.PreferredCell
+	}
+
+	newSubConns := grpcresolver.NewAddressMap()
+	for _, addr := range s.ResolverState.Addresses {
+		if v, ok := b.subConns.Get(addr); ok {
+			newSubConns.Set(addr, v)
+			continue
+		}
+
+		// sc is assigned after NewSubConn returns, but the StateListener
+		// closure captures it by reference rather than by value: NewSubConn
+		// does not invoke the listener synchronously, so the assignment below
+		// always happens before the first callback fires.
+		var sc balancer.SubConn
+		sc, err := b.cc.NewSubConn([]grpcresolver.Address{addr}, balancer.NewSubConnOptions{
+			StateListener: func(s balancer.SubConnState) { b.updateSubConnState(sc, s) },
+		})
+		if err != nil {
+			continue
+		}
+
+		newSubConns.Set(addr, &subConnEntry{sc: sc, addr: addr})
+		b.scStates[sc] = connectivity.Idle
+		sc.Connect()
+	}
+
+	for _, addr := range b.subConns.Keys() {
+		if _, ok := newSubConns.Get(addr); ok {
+			continue
+		}
+
+		v, _ := b.subConns.Get(addr)
+		entry := v.(*subConnEntry)
+		entry.sc.Shutdown()
+		delete(b.scStates, entry.sc)
+	}
+
+	b.subConns = newSubConns
+
+	b.mu.Unlock()
+
+	b.regeneratePicker()
+	return nil
+}
+
+// ResolverError is part of the balancer.Balancer interface.
+func (b *localityBalancer) ResolverError(error) {}
+
+// UpdateSubConnState is part of the balancer.Balancer interface. It is never
+// called in practice: every SubConn is created with a StateListener (see
+// UpdateClientConnState), which grpc-core prefers over this method, and
+// updateSubConnState is the single place that reacts to a state change.
+func (b *localityBalancer) UpdateSubConnState(sc balancer.SubConn, s balancer.SubConnState) {
+	b.updateSubConnState(sc, s)
+}
+
+// updateSubConnState records sc's new connectivity state (or forgets sc
+// entirely once it reports Shutdown, since cleanup beyond that point is
+// handled by UpdateClientConnState removing it from subConns/scStates) and
+// regenerates the picker to reflect the change.
+func (b *localityBalancer) updateSubConnState(sc balancer.SubConn, s balancer.SubConnState) {
+	b.mu.Lock()
+	if s.ConnectivityState == connectivity.Shutdown {
+		delete(b.scStates, sc)
+		b.mu.Unlock()
+		return
+	}
+
+	b.scStates[sc] = s.ConnectivityState
+	b.mu.Unlock()
+
+	if s.ConnectivityState == connectivity.Idle {
+		sc.Connect()
+	}
+
+	b.regeneratePicker()
+}
+
+// Close is part of the balancer.Balancer interface.
+func (b *localityBalancer) Close() {}
+
+// regeneratePicker rebuilds and pushes a picker reflecting the current ready
+// SubConn set and preferredCell. Each ready SubConn is repeated in the
+// candidate list according to its address's SourceWeightAttributeKey (see
+// sourceWeight), so roundRobinPicker's cycling gives heavier-weighted
+// sources proportionally more picks.
+func (b *localityBalancer) regeneratePicker() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var all, local []balancer.SubConn
+	for _, v := range b.subConns.Values() {
+		entry := v.(*subConnEntry)
+		if b.scStates[entry.sc] != connectivity.Ready {
+			continue
+		}
+
+		weight := sourceWeight(entry.addr)
+		isLocal := b.preferredCell != "" && cellOf(entry.addr) == b.preferredCell
+		for i := 0; i < weight; i++ {
+			all = append(all, entry.sc)
+			if isLocal {
+				local = append(local, entry.sc)
+			}
+		}
+	}
+
+	if len(all) == 0 {
+		b.cc.UpdateState(balancer.State{
+			ConnectivityState: connectivity.TransientFailure,
+			Picker:            &errPicker{err: balancer.ErrNoSubConnAvailable},
+		})
+
+		return
+	}
+
+	subConns := all
+	if len(local) > 0 {
+		subConns = local
+	}
+
+	b.cc.UpdateState(balancer.State{
+		ConnectivityState: connectivity.Ready,
+		Picker:            &roundRobinPicker{subConns: subConns},
+	})
+}
+
+// cellOf returns the CellAttributeKey BalancerAttribute of addr, or "" if
+// unset.
+func cellOf(addr grpcresolver.Address) string {
+	if addr.BalancerAttributes == nil {
+		return ""
+	}
+
+	cell, _ := addr.BalancerAttributes.Value(CellAttributeKey).(string)
+	return cell
+}
+
+// sourceWeight returns addr's SourceWeightAttributeKey BalancerAttribute
+// (see withSourceWeight), defaulting to 1 and clamped to
+// maxSourceWeightRepeat when unset, malformed, or out of range.
+func sourceWeight(addr grpcresolver.Address) int {
+	if addr.BalancerAttributes == nil {
+		return 1
+	}
+
+	s, _ := addr.BalancerAttributes.Value(SourceWeightAttributeKey).(string)
+	weight, err := strconv.Atoi(s)
+	if err != nil || weight < 1 {
+		return 1
+	}
+	if weight > maxSourceWeightRepeat {
+		return maxSourceWeightRepeat
+	}
+
+	return weight
+}
+
+// errPicker always fails picks with err; used while no SubConn is ready.
+type errPicker struct{ err error }
+
+// Pick is part of the balancer.Picker interface.
+func (p *errPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	return balancer.PickResult{}, p.err
+}
+
+// roundRobinPicker round-robins across a fixed set of SubConns. A SubConn
+// can appear more than once in subConns, which regeneratePicker uses to
+// approximate weighted round-robin across sources.
+type roundRobinPicker struct {
+	mu       sync.Mutex
+	next     int
+	subConns []balancer.SubConn
+}
+
+// Pick is part of the balancer.Picker interface.
+func (p *roundRobinPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	p.mu.Lock()
+	sc := p.subConns[p.next%len(p.subConns)]
+	p.next++
+	p.mu.Unlock()
+
+	return balancer.PickResult{SubConn: sc}, nil
+}
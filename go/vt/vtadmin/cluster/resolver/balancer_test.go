@@ -0,0 +1,277 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolver
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/connectivity"
+	grpcresolver "google.golang.org/grpc/resolver"
+)
+
+// fakeSubConn satisfies balancer.SubConn (via promotion from the embedded,
+// always-nil interface) without depending on its exact method set, which
+// varies across grpc-go versions. Nothing in this file invokes a method on
+// it; it only needs a stable identity so tests can assert on which SubConn a
+// picker returned.
+type fakeSubConn struct {
+	balancer.SubConn
+	id int
+}
+
+// testSubConn is a real (not nil-promoted) balancer.SubConn, for driving
+// tests where localityBalancer itself calls Connect/Shutdown on the SubConns
+// it creates. listener is opts.StateListener from the NewSubConn call that
+// produced it, exposed so tests can simulate connectivity state changes.
+type testSubConn struct {
+	listener func(balancer.SubConnState)
+}
+
+func (*testSubConn) UpdateAddresses([]grpcresolver.Address) {}
+func (*testSubConn) Connect()                               {}
+func (*testSubConn) Shutdown()                              {}
+func (*testSubConn) GetOrBuildProducer(balancer.ProducerBuilder) (balancer.Producer, func()) {
+	return nil, func() {}
+}
+
+// testClientConn is a minimal balancer.ClientConn recording the SubConns
+// localityBalancer creates and the balancer.State it last pushed, for use
+// across this file's UpdateClientConnState/regeneratePicker tests.
+type testClientConn struct {
+	m         sync.Mutex
+	subConns  []*testSubConn
+	lastState balancer.State
+}
+
+func (c *testClientConn) NewSubConn(_ []grpcresolver.Address, opts balancer.NewSubConnOptions) (balancer.SubConn, error) {
+	sc := &testSubConn{listener: opts.StateListener}
+
+	c.m.Lock()
+	c.subConns = append(c.subConns, sc)
+	c.m.Unlock()
+
+	return sc, nil
+}
+
+func (c *testClientConn) RemoveSubConn(balancer.SubConn)                           {}
+func (c *testClientConn) UpdateAddresses(balancer.SubConn, []grpcresolver.Address) {}
+func (c *testClientConn) ResolveNow(grpcresolver.ResolveNowOptions)                {}
+func (c *testClientConn) Target() string                                           { return "" }
+
+func (c *testClientConn) UpdateState(s balancer.State) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.lastState = s
+}
+
+func (c *testClientConn) subConnCount() int {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return len(c.subConns)
+}
+
+func (c *testClientConn) allSubConns() []*testSubConn {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return append([]*testSubConn(nil), c.subConns...)
+}
+
+func (c *testClientConn) currentState() balancer.State {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.lastState
+}
+
+func TestLocalityBalancerBuilder_ParseConfig(t *testing.T) {
+	b := &localityBalancerBuilder{}
+
+	cfg, err := b.ParseConfig([]byte(`{"preferredCell":"zone1"}`))
+	require.NoError(t, err)
+
+	lbc, ok := cfg.(localityBalancerConfig)
+	require.True(t, ok)
+	assert.Equal(t, "zone1", lbc.PreferredCell)
+}
+
+func TestLocalityBalancerBuilder_Name(t *testing.T) {
+	assert.Equal(t, LocalityBalancerName, (&localityBalancerBuilder{}).Name())
+}
+
+func TestCellOf(t *testing.T) {
+	t.Run("no attributes", func(t *testing.T) {
+		assert.Equal(t, "", cellOf(grpcresolver.Address{}))
+	})
+
+	t.Run("cell attribute present", func(t *testing.T) {
+		addr := grpcresolver.Address{
+			BalancerAttributes: attributes.New(CellAttributeKey, "zone2"),
+		}
+
+		assert.Equal(t, "zone2", cellOf(addr))
+	})
+}
+
+func TestSourceWeight(t *testing.T) {
+	t.Run("no attributes defaults to 1", func(t *testing.T) {
+		assert.Equal(t, 1, sourceWeight(grpcresolver.Address{}))
+	})
+
+	t.Run("valid weight attribute", func(t *testing.T) {
+		addr := grpcresolver.Address{BalancerAttributes: attributes.New(SourceWeightAttributeKey, "3")}
+		assert.Equal(t, 3, sourceWeight(addr))
+	})
+
+	t.Run("malformed or non-positive weight defaults to 1", func(t *testing.T) {
+		for _, v := range []string{"", "nope", "0", "-1"} {
+			addr := grpcresolver.Address{BalancerAttributes: attributes.New(SourceWeightAttributeKey, v)}
+			assert.Equal(t, 1, sourceWeight(addr), "weight %q", v)
+		}
+	})
+
+	t.Run("clamped to maxSourceWeightRepeat", func(t *testing.T) {
+		addr := grpcresolver.Address{BalancerAttributes: attributes.New(SourceWeightAttributeKey, "100000")}
+		assert.Equal(t, maxSourceWeightRepeat, sourceWeight(addr))
+	})
+}
+
+func TestRoundRobinPicker_CyclesInOrder(t *testing.T) {
+	scs := []balancer.SubConn{
+		&fakeSubConn{id: 1},
+		&fakeSubConn{id: 2},
+		&fakeSubConn{id: 3},
+	}
+
+	p := &roundRobinPicker{subConns: scs}
+
+	var got []int
+	for i := 0; i < len(scs)*2; i++ {
+		res, err := p.Pick(balancer.PickInfo{})
+		require.NoError(t, err)
+		got = append(got, res.SubConn.(*fakeSubConn).id)
+	}
+
+	assert.Equal(t, []int{1, 2, 3, 1, 2, 3}, got)
+}
+
+func TestErrPicker(t *testing.T) {
+	wantErr := assert.AnError
+
+	p := &errPicker{err: wantErr}
+	_, err := p.Pick(balancer.PickInfo{})
+
+	assert.Equal(t, wantErr, err)
+}
+
+// weightedAddrs returns the same two addresses on every call, but as fresh
+// grpcresolver.Address values carrying newly-allocated Attributes bags each
+// time -- mirroring what resolve() does on every real resolve via
+// attributesFromHostInfo/withSourceWeight.
+func weightedAddrs() []grpcresolver.Address {
+	return []grpcresolver.Address{
+		{Addr: "10.0.0.1:15999", Attributes: attributes.New(SourceWeightAttributeKey, "1")},
+		{Addr: "10.0.0.2:15999", Attributes: attributes.New(SourceWeightAttributeKey, "1")},
+	}
+}
+
+func TestLocalityBalancer_UpdateClientConnState_ReusesSubConnsAcrossResolves(t *testing.T) {
+	cc := &testClientConn{}
+	b := (&localityBalancerBuilder{}).Build(cc, balancer.BuildOptions{}).(*localityBalancer)
+
+	require.NoError(t, b.UpdateClientConnState(balancer.ClientConnState{
+		ResolverState: grpcresolver.State{Addresses: weightedAddrs()},
+	}))
+	require.Equal(t, 2, cc.subConnCount())
+
+	// Re-resolve with the same two addresses, each now carrying a distinct
+	// Attributes pointer (but equal content). SubConns must be reused, not
+	// torn down and recreated.
+	require.NoError(t, b.UpdateClientConnState(balancer.ClientConnState{
+		ResolverState: grpcresolver.State{Addresses: weightedAddrs()},
+	}))
+
+	assert.Equal(t, 2, cc.subConnCount(), "no new SubConns should be created for addresses already present")
+}
+
+func TestLocalityBalancer_UpdateClientConnState_ForgetsRemovedAddresses(t *testing.T) {
+	cc := &testClientConn{}
+	b := (&localityBalancerBuilder{}).Build(cc, balancer.BuildOptions{}).(*localityBalancer)
+
+	require.NoError(t, b.UpdateClientConnState(balancer.ClientConnState{
+		ResolverState: grpcresolver.State{Addresses: weightedAddrs()},
+	}))
+	require.Equal(t, 2, cc.subConnCount())
+
+	require.NoError(t, b.UpdateClientConnState(balancer.ClientConnState{
+		ResolverState: grpcresolver.State{Addresses: weightedAddrs()[:1]},
+	}))
+
+	b.mu.Lock()
+	remaining := b.subConns.Len()
+	b.mu.Unlock()
+	assert.Equal(t, 1, remaining, "the dropped address's SubConn must be removed from the balancer's own bookkeeping")
+}
+
+func TestLocalityBalancer_PreferredCellVsFallbackPicking(t *testing.T) {
+	addrs := []grpcresolver.Address{
+		{Addr: "10.0.0.1:15999", BalancerAttributes: attributes.New(CellAttributeKey, "zone1")},
+		{Addr: "10.0.0.2:15999", BalancerAttributes: attributes.New(CellAttributeKey, "zone2")},
+	}
+
+	t.Run("a preferred-cell match narrows the picker to that cell", func(t *testing.T) {
+		cc := &testClientConn{}
+		b := (&localityBalancerBuilder{}).Build(cc, balancer.BuildOptions{}).(*localityBalancer)
+
+		require.NoError(t, b.UpdateClientConnState(balancer.ClientConnState{
+			BalancerConfig: localityBalancerConfig{PreferredCell: "zone1"},
+			ResolverState:  grpcresolver.State{Addresses: addrs},
+		}))
+
+		for _, sc := range cc.allSubConns() {
+			sc.listener(balancer.SubConnState{ConnectivityState: connectivity.Ready})
+		}
+
+		state := cc.currentState()
+		require.Equal(t, connectivity.Ready, state.ConnectivityState)
+		picker, ok := state.Picker.(*roundRobinPicker)
+		require.True(t, ok)
+		assert.Len(t, picker.subConns, 1, "only the zone1 SubConn should be picked when a preferred-cell match exists")
+	})
+
+	t.Run("no matching cell falls back to round_robin across every ready SubConn", func(t *testing.T) {
+		cc := &testClientConn{}
+		b := (&localityBalancerBuilder{}).Build(cc, balancer.BuildOptions{}).(*localityBalancer)
+
+		require.NoError(t, b.UpdateClientConnState(balancer.ClientConnState{
+			BalancerConfig: localityBalancerConfig{PreferredCell: "zone9"},
+			ResolverState:  grpcresolver.State{Addresses: addrs},
+		}))
+
+		for _, sc := range cc.allSubConns() {
+			sc.listener(balancer.SubConnState{ConnectivityState: connectivity.Ready})
+		}
+
+		picker, ok := cc.currentState().Picker.(*roundRobinPicker)
+		require.True(t, ok)
+		assert.Len(t, picker.subConns, 2, "no SubConn matches the preferred cell, so all ready SubConns are used")
+	})
+}
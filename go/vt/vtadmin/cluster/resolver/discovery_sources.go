@@ -0,0 +1,257 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"vitess.io/vitess/go/vt/vtadmin/cluster/discovery"
+)
+
+// DiscoverySource is one entry in an ordered, prioritized set of discovery
+// backends a resolver queries for addresses. Sources are grouped into
+// failover tiers by Priority: lower values are queried first, and a tier is
+// only consulted once every source in every lower-numbered tier has returned
+// zero addresses or errored within Options.DiscoveryTimeout. Weight is
+// carried onto each resolved HostInfo via SourceWeightAttributeKey (see
+// withSourceWeight), and consumed by the vtadmin_locality balancer policy's
+// picker for weighted round-robin across sources (see
+// (*localityBalancer).regeneratePicker in balancer.go); it has no effect
+// under pick_first or grpc's own round_robin. queryTier dedups addresses
+// within a tier by Addr before returning them (a given address is only ever
+// emitted once, carrying the weight of whichever source happened to win the
+// race), so repeating an address across sources does not produce duplicate
+// SubConns.
+type DiscoverySource struct {
+	Name      string
+	Discovery discovery.Discovery
+	Weight    int
+	Priority  int
+}
+
+// DiscoverySourceSpec is the name/priority/weight portion of a
+// DiscoverySource, parsed from a repeated --discovery-source flag value of
+// the form "name=<name>,priority=<n>,weight=<n>". It does not carry a
+// discovery.Discovery implementation: discovery backends (consul clients,
+// static JSON files, etc.) carry connection state that can't be built from a
+// flag string alone, so callers pair specs with constructed backends by Name
+// via Options.ResolveDiscoverySources.
+type DiscoverySourceSpec struct {
+	Name     string
+	Weight   int
+	Priority int
+}
+
+// String is part of the pflag.Value interface (via discoverySourceSpecsVar).
+func (s DiscoverySourceSpec) String() string {
+	return fmt.Sprintf("name=%s,priority=%d,weight=%d", s.Name, s.Priority, s.Weight)
+}
+
+func parseDiscoverySourceSpec(s string) (DiscoverySourceSpec, error) {
+	spec := DiscoverySourceSpec{Weight: 1}
+
+	for _, kv := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return DiscoverySourceSpec{}, fmt.Errorf("invalid --discovery-source component %q; expected key=value", kv)
+		}
+
+		switch k {
+		case "name":
+			spec.Name = v
+		case "priority":
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return DiscoverySourceSpec{}, fmt.Errorf("invalid --discovery-source priority %q: %w", v, err)
+			}
+
+			spec.Priority = n
+		case "weight":
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return DiscoverySourceSpec{}, fmt.Errorf("invalid --discovery-source weight %q: %w", v, err)
+			}
+
+			spec.Weight = n
+		default:
+			return DiscoverySourceSpec{}, fmt.Errorf("invalid --discovery-source component %q: unknown key %s", kv, k)
+		}
+	}
+
+	if spec.Name == "" {
+		return DiscoverySourceSpec{}, fmt.Errorf("invalid --discovery-source %q: name is required", s)
+	}
+
+	return spec, nil
+}
+
+// discoverySourceSpecsVar implements pflag.Value for the repeated
+// --discovery-source flag, appending to the DiscoverySourceSpec slice it
+// wraps on every occurrence of the flag.
+type discoverySourceSpecsVar struct {
+	specs *[]DiscoverySourceSpec
+}
+
+// String is part of the pflag.Value interface.
+func (v *discoverySourceSpecsVar) String() string {
+	if v.specs == nil || len(*v.specs) == 0 {
+		return ""
+	}
+
+	strs := make([]string, len(*v.specs))
+	for i, spec := range *v.specs {
+		strs[i] = spec.String()
+	}
+
+	return strings.Join(strs, ",")
+}
+
+// Set is part of the pflag.Value interface.
+func (v *discoverySourceSpecsVar) Set(s string) error {
+	spec, err := parseDiscoverySourceSpec(s)
+	if err != nil {
+		return err
+	}
+
+	*v.specs = append(*v.specs, spec)
+	return nil
+}
+
+// Type is part of the pflag.Value interface.
+func (*discoverySourceSpecsVar) Type() string { return "resolver.DiscoverySourceSpec" }
+
+// ResolveDiscoverySources pairs each parsed entry in opts.DiscoverySourceSpecs
+// with a constructed discovery.Discovery from discoveries (keyed by Name),
+// populating opts.DiscoverySources. Call this once, after flag parsing and
+// after constructing the named discovery.Discovery backends, and before
+// opts.NewBuilder.
+func (opts *Options) ResolveDiscoverySources(discoveries map[string]discovery.Discovery) error {
+	sources := make([]DiscoverySource, 0, len(opts.DiscoverySourceSpecs))
+	for _, spec := range opts.DiscoverySourceSpecs {
+		d, ok := discoveries[spec.Name]
+		if !ok {
+			return fmt.Errorf("no discovery.Discovery registered for --discovery-source name %q", spec.Name)
+		}
+
+		sources = append(sources, DiscoverySource{
+			Name:      spec.Name,
+			Discovery: d,
+			Weight:    spec.Weight,
+			Priority:  spec.Priority,
+		})
+	}
+
+	opts.DiscoverySources = sources
+	return nil
+}
+
+// sourceFetcher is the resolved, per-component fetch function for a single
+// DiscoverySource, built once in builder.build.
+type sourceFetcher struct {
+	name     string
+	weight   int
+	priority int
+	fetch    func(context.Context, []string) ([]HostInfo, error)
+}
+
+// hostInfoFetcher adapts a discovery.Discovery's vtctld/vtgate discovery
+// methods for host into a uniform func returning []HostInfo, preferring the
+// MetadataDiscovery variant when d implements it.
+func hostInfoFetcher(d discovery.Discovery, host string) (func(context.Context, []string) ([]HostInfo, error), error) {
+	md, hasMetadata := d.(MetadataDiscovery)
+
+	var (
+		metaFn  func(context.Context, []string) ([]HostInfo, error)
+		plainFn func(context.Context, []string) ([]string, error)
+	)
+
+	switch host {
+	case "vtctld":
+		if hasMetadata {
+			metaFn = md.DiscoverVtctldAddrsWithMetadata
+		} else {
+			plainFn = d.DiscoverVtctldAddrs
+		}
+	case "vtgate":
+		if hasMetadata {
+			metaFn = md.DiscoverVTGateAddrsWithMetadata
+		} else {
+			plainFn = d.DiscoverVTGateAddrs
+		}
+	default:
+		return nil, fmt.Errorf("%s: unsupported URL host %s", logPrefix, host)
+	}
+
+	if metaFn != nil {
+		return metaFn, nil
+	}
+
+	return func(ctx context.Context, tags []string) ([]HostInfo, error) {
+		addrs, err := plainFn(ctx, tags)
+		if err != nil {
+			return nil, err
+		}
+
+		hosts := make([]HostInfo, len(addrs))
+		for i, addr := range addrs {
+			hosts[i] = HostInfo{Addr: addr}
+		}
+
+		return hosts, nil
+	}, nil
+}
+
+// SourceWeightAttributeKey is the HostInfo.Attrs key carrying a
+// DiscoverySource's configured Weight. Only the vtadmin_locality balancer
+// policy reads it (see sourceWeight in balancer.go); pick_first and
+// round_robin ignore it.
+const SourceWeightAttributeKey = "source_weight"
+
+// withSourceWeight returns a copy of host with SourceWeightAttributeKey set
+// to weight, leaving host's own Attrs untouched.
+func withSourceWeight(host HostInfo, weight int) HostInfo {
+	attrs := make(map[string]string, len(host.Attrs)+1)
+	for k, v := range host.Attrs {
+		attrs[k] = v
+	}
+
+	attrs[SourceWeightAttributeKey] = strconv.Itoa(weight)
+	host.Attrs = attrs
+
+	return host
+}
+
+// groupByPriority partitions fetchers, which must already be sorted by
+// priority, into consecutive tiers sharing the same priority.
+func groupByPriority(fetchers []sourceFetcher) [][]sourceFetcher {
+	var tiers [][]sourceFetcher
+
+	for i := 0; i < len(fetchers); {
+		j := i
+		for j < len(fetchers) && fetchers[j].priority == fetchers[i].priority {
+			j++
+		}
+
+		tiers = append(tiers, fetchers[i:j])
+		i = j
+	}
+
+	return tiers
+}
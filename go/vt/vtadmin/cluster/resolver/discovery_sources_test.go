@@ -0,0 +1,180 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDiscoverySourceSpec(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		expected DiscoverySourceSpec
+		wantErr  bool
+	}{
+		{
+			name:     "name, priority, and weight",
+			in:       "name=consul,priority=0,weight=3",
+			expected: DiscoverySourceSpec{Name: "consul", Priority: 0, Weight: 3},
+		},
+		{
+			name:     "weight defaults to 1 when omitted",
+			in:       "name=static,priority=1",
+			expected: DiscoverySourceSpec{Name: "static", Priority: 1, Weight: 1},
+		},
+		{name: "missing name", in: "priority=0,weight=1", wantErr: true},
+		{name: "unknown key", in: "name=consul,bogus=1", wantErr: true},
+		{name: "non-integer priority", in: "name=consul,priority=nope", wantErr: true},
+		{name: "malformed component", in: "name", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := parseDiscoverySourceSpec(tt.in)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, spec)
+		})
+	}
+}
+
+func TestGroupByPriority(t *testing.T) {
+	fetchers := []sourceFetcher{
+		{name: "a", priority: 0},
+		{name: "b", priority: 0},
+		{name: "c", priority: 1},
+		{name: "d", priority: 2},
+		{name: "e", priority: 2},
+	}
+
+	tiers := groupByPriority(fetchers)
+	require.Len(t, tiers, 3)
+
+	assert.Equal(t, []string{"a", "b"}, namesOf(tiers[0]))
+	assert.Equal(t, []string{"c"}, namesOf(tiers[1]))
+	assert.Equal(t, []string{"d", "e"}, namesOf(tiers[2]))
+}
+
+func namesOf(fetchers []sourceFetcher) []string {
+	names := make([]string, len(fetchers))
+	for i, f := range fetchers {
+		names[i] = f.name
+	}
+
+	return names
+}
+
+func TestWithSourceWeight(t *testing.T) {
+	host := HostInfo{Addr: "10.0.0.1:15999", Attrs: map[string]string{"cell": "zone1"}}
+
+	weighted := withSourceWeight(host, 5)
+
+	assert.Equal(t, "5", weighted.Attrs[SourceWeightAttributeKey])
+	assert.Equal(t, "zone1", weighted.Attrs["cell"])
+
+	// The original host's Attrs map must be untouched.
+	assert.NotContains(t, host.Attrs, SourceWeightAttributeKey)
+}
+
+func TestQueryTier_UnionAndDedup(t *testing.T) {
+	r, _ := newTestResolver(Options{}, nil)
+
+	tier := []sourceFetcher{
+		fetcherReturning("consul", 0, []HostInfo{{Addr: "10.0.0.1:15999"}, {Addr: "10.0.0.2:15999"}}, nil),
+		fetcherReturning("static", 0, []HostInfo{{Addr: "10.0.0.2:15999"}, {Addr: "10.0.0.3:15999"}}, nil),
+	}
+
+	hosts, err := r.queryTier(context.Background(), tier, nil)
+	require.NoError(t, err)
+
+	seen := make(map[string]int)
+	for _, h := range hosts {
+		seen[h.Addr]++
+	}
+
+	assert.Len(t, hosts, 3, "duplicate address across sources in the same tier must be collapsed")
+	assert.Equal(t, 1, seen["10.0.0.1:15999"])
+	assert.Equal(t, 1, seen["10.0.0.2:15999"])
+	assert.Equal(t, 1, seen["10.0.0.3:15999"])
+
+	for _, h := range hosts {
+		assert.Equal(t, "1", h.Attrs[SourceWeightAttributeKey])
+	}
+}
+
+func TestQueryTier_ErrorOnlyWhenEverySourceErrors(t *testing.T) {
+	r, _ := newTestResolver(Options{}, nil)
+
+	t.Run("one of two sources errors", func(t *testing.T) {
+		tier := []sourceFetcher{
+			fetcherReturning("consul", 0, nil, assert.AnError),
+			fetcherReturning("static", 0, []HostInfo{{Addr: "10.0.0.1:15999"}}, nil),
+		}
+
+		hosts, err := r.queryTier(context.Background(), tier, nil)
+		require.NoError(t, err)
+		assert.Len(t, hosts, 1)
+	})
+
+	t.Run("every source errors", func(t *testing.T) {
+		tier := []sourceFetcher{
+			fetcherReturning("consul", 0, nil, assert.AnError),
+			fetcherReturning("static", 0, nil, assert.AnError),
+		}
+
+		hosts, err := r.queryTier(context.Background(), tier, nil)
+		assert.Error(t, err)
+		assert.Empty(t, hosts)
+	})
+}
+
+func TestDiscoverAddrs_FallsThroughEmptyOrErroredTiers(t *testing.T) {
+	fetchers := []sourceFetcher{
+		fetcherReturning("primary", 0, nil, assert.AnError),
+		fetcherReturning("fallback", 1, []HostInfo{{Addr: "10.0.0.9:15999"}}, nil),
+	}
+
+	r, _ := newTestResolver(Options{}, fetchers)
+
+	hosts, err := r.discoverAddrs(context.Background(), nil)
+	require.NoError(t, err)
+	require.Len(t, hosts, 1)
+	assert.Equal(t, "10.0.0.9:15999", hosts[0].Addr)
+}
+
+func TestDiscoverAddrs_PreferredTierWins(t *testing.T) {
+	fetchers := []sourceFetcher{
+		fetcherReturning("primary", 0, []HostInfo{{Addr: "10.0.0.1:15999"}}, nil),
+		fetcherReturning("fallback", 1, []HostInfo{{Addr: "10.0.0.9:15999"}}, nil),
+	}
+
+	r, _ := newTestResolver(Options{}, fetchers)
+
+	hosts, err := r.discoverAddrs(context.Background(), nil)
+	require.NoError(t, err)
+	require.Len(t, hosts, 1)
+	assert.Equal(t, "10.0.0.1:15999", hosts[0].Addr, "a non-empty higher-priority tier must win; lower tiers aren't consulted")
+}
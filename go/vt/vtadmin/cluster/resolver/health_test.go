@@ -0,0 +1,217 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// startHealthServer starts a real, loopback grpc.health.v1.Health server
+// reporting status for "", returning its address and a stop func.
+func startHealthServer(t *testing.T, status grpc_health_v1.HealthCheckResponse_ServingStatus) (addr string, stop func()) {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	hs := health.NewServer()
+	hs.SetServingStatus("", status)
+
+	srv := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(srv, hs)
+
+	go srv.Serve(lis)
+
+	return lis.Addr().String(), srv.Stop
+}
+
+func newHealthTestResolver(t *testing.T, concurrency int) *resolver {
+	t.Helper()
+
+	r, _ := newTestResolver(Options{
+		EnableHealthChecks:     true,
+		HealthCheckTimeout:     2 * time.Second,
+		HealthCheckConcurrency: concurrency,
+		HealthCheckDialOptions: []grpc.DialOption{grpc.WithInsecure()},
+	}, nil)
+
+	return r
+}
+
+func TestCheckHealth_Serving(t *testing.T) {
+	addr, stop := startHealthServer(t, grpc_health_v1.HealthCheckResponse_SERVING)
+	defer stop()
+
+	r := newHealthTestResolver(t, 1)
+
+	healthy, err := r.checkHealth(context.Background(), addr)
+	require.NoError(t, err)
+	assert.True(t, healthy)
+}
+
+func TestCheckHealth_NotServing(t *testing.T) {
+	addr, stop := startHealthServer(t, grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	defer stop()
+
+	r := newHealthTestResolver(t, 1)
+
+	healthy, err := r.checkHealth(context.Background(), addr)
+	require.NoError(t, err)
+	assert.False(t, healthy)
+}
+
+func TestCheckHealth_DialFailure(t *testing.T) {
+	// Reserve a loopback address, then close it immediately so nothing is
+	// listening: dialing it should fail.
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := lis.Addr().String()
+	require.NoError(t, lis.Close())
+
+	r := newHealthTestResolver(t, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	healthy, err := r.checkHealth(ctx, addr)
+	assert.False(t, healthy)
+	assert.Error(t, err)
+}
+
+func TestProbeAddr_EjectsAfterConsecutiveFailures(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := lis.Addr().String()
+	require.NoError(t, lis.Close())
+
+	r := newHealthTestResolver(t, 1)
+
+	// newHealthTestResolver's HealthCheckTimeout already bounds each dial, and
+	// probeAddr is called independently below (as the resolver does in
+	// production, against its long-lived r.ctx); sharing one short-lived ctx
+	// across every call would let a single blocking failed dial exhaust the
+	// whole budget before the later probes even run.
+	ctx := context.Background()
+
+	for i := 0; i < healthCheckFailureThreshold-1; i++ {
+		assert.False(t, r.probeAddr(ctx, addr))
+	}
+
+	r.m.Lock()
+	stillNotEjected := r.healthStats[addr].ejectedUntil.IsZero()
+	r.m.Unlock()
+	assert.True(t, stillNotEjected, "address should not be ejected before reaching the failure threshold")
+
+	// This probe reaches the threshold and should eject.
+	assert.False(t, r.probeAddr(ctx, addr))
+
+	r.m.Lock()
+	ejectedUntil := r.healthStats[addr].ejectedUntil
+	r.m.Unlock()
+	assert.False(t, ejectedUntil.IsZero(), "address should be ejected once the failure threshold is reached")
+}
+
+func TestProbeAddr_StickyEjectionSkipsReprobingDuringCooldown(t *testing.T) {
+	// Start "down" to accumulate failures past the threshold.
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := lis.Addr().String()
+	require.NoError(t, lis.Close())
+
+	r := newHealthTestResolver(t, 1)
+
+	// See the comment in TestProbeAddr_EjectsAfterConsecutiveFailures: every
+	// probeAddr call shares an unbounded ctx, and checkHealth applies
+	// HealthCheckTimeout to each call separately, since a blocking failed dial
+	// can by itself consume the whole HealthCheckTimeout.
+	ctx := context.Background()
+
+	for i := 0; i < healthCheckFailureThreshold; i++ {
+		r.probeAddr(ctx, addr)
+	}
+
+	r.m.Lock()
+	require.False(t, r.healthStats[addr].ejectedUntil.IsZero())
+	r.m.Unlock()
+
+	// Bring the address back up on the exact same address. Because it's
+	// still within its ejection cooldown, probeAddr must report unhealthy
+	// without re-probing (sticky ejection), rather than immediately flipping
+	// back to healthy.
+	_, stopUp := startHealthServerOn(t, lis.Addr(), grpc_health_v1.HealthCheckResponse_SERVING)
+	defer stopUp()
+
+	assert.False(t, r.probeAddr(ctx, addr), "address should stay ejected during its cooldown window even though it is now healthy")
+
+	// Simulate the cooldown having elapsed and confirm the address is
+	// re-admitted on the next probe.
+	r.m.Lock()
+	r.healthStats[addr].ejectedUntil = time.Now().UTC().Add(-time.Second)
+	r.m.Unlock()
+
+	assert.True(t, r.probeAddr(ctx, addr), "address should be re-admitted once its cooldown has elapsed and it probes healthy again")
+}
+
+// startHealthServerOn is like startHealthServer, but binds to a specific
+// address (used to bring a previously down address back up).
+func startHealthServerOn(t *testing.T, addr net.Addr, status grpc_health_v1.HealthCheckResponse_ServingStatus) (string, func()) {
+	t.Helper()
+
+	lis, err := net.Listen(addr.Network(), addr.String())
+	require.NoError(t, err)
+
+	hs := health.NewServer()
+	hs.SetServingStatus("", status)
+
+	srv := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(srv, hs)
+
+	go srv.Serve(lis)
+
+	return lis.Addr().String(), srv.Stop
+}
+
+func TestFilterHealthyAddrs_DedupsAndFiltersUnhealthy(t *testing.T) {
+	upAddr, stopUp := startHealthServer(t, grpc_health_v1.HealthCheckResponse_SERVING)
+	defer stopUp()
+
+	downLis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	downAddr := downLis.Addr().String()
+	require.NoError(t, downLis.Close())
+
+	r := newHealthTestResolver(t, 4)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	hosts := []HostInfo{{Addr: upAddr}, {Addr: upAddr}, {Addr: downAddr}}
+	healthy := r.filterHealthyAddrs(ctx, hosts)
+
+	require.Len(t, healthy, 1)
+	assert.Equal(t, upAddr, healthy[0].Addr)
+}
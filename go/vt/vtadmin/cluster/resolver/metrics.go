@@ -0,0 +1,95 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolver
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricsCollector is the set of metrics a resolver emits over the course of
+// its lifetime. It is an interface so tests can substitute noopMetrics
+// instead of registering against (and polluting) the default prometheus
+// registry.
+type metricsCollector interface {
+	// ObserveDiscoveryDuration records how long a single discovery.Discovery
+	// lookup took for cluster/component.
+	ObserveDiscoveryDuration(cluster, component string, seconds float64)
+	// IncResolveTotal increments the resolve counter for cluster/component,
+	// partitioned by result (one of "success", "error", "empty").
+	IncResolveTotal(cluster, component, result string)
+	// SetAddresses records the number of addresses currently published to
+	// the ClientConn for cluster/component.
+	SetAddresses(cluster, component string, n int)
+	// IncAddressChurn increments the address churn counter for
+	// cluster/component, partitioned by change (one of "added", "removed").
+	IncAddressChurn(cluster, component, change string)
+}
+
+var (
+	discoveryDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "vtadmin_resolver_discovery_duration_seconds",
+		Help: "Time taken to discover addresses for a cluster/component via discovery.Discovery.",
+	}, []string{"cluster", "component"})
+
+	resolveTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "vtadmin_resolver_resolve_total",
+		Help: "Total number of resolve attempts, partitioned by result (success|error|empty).",
+	}, []string{"cluster", "component", "result"})
+
+	addresses = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "vtadmin_resolver_addresses",
+		Help: "Current number of addresses published to the ClientConn for a cluster/component.",
+	}, []string{"cluster", "component"})
+
+	addressChurnTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "vtadmin_resolver_address_churn_total",
+		Help: "Total number of addresses added or removed across resolves, partitioned by change (added|removed).",
+	}, []string{"cluster", "component", "change"})
+)
+
+func init() {
+	prometheus.MustRegister(discoveryDurationSeconds, resolveTotal, addresses, addressChurnTotal)
+}
+
+// promMetrics is the default metricsCollector, emitting to the package-level
+// prometheus collectors registered in init.
+type promMetrics struct{}
+
+func (promMetrics) ObserveDiscoveryDuration(cluster, component string, seconds float64) {
+	discoveryDurationSeconds.WithLabelValues(cluster, component).Observe(seconds)
+}
+
+func (promMetrics) IncResolveTotal(cluster, component, result string) {
+	resolveTotal.WithLabelValues(cluster, component, result).Inc()
+}
+
+func (promMetrics) SetAddresses(cluster, component string, n int) {
+	addresses.WithLabelValues(cluster, component).Set(float64(n))
+}
+
+func (promMetrics) IncAddressChurn(cluster, component, change string) {
+	addressChurnTotal.WithLabelValues(cluster, component, change).Inc()
+}
+
+// noopMetrics discards all metrics. Used by tests that don't want to touch
+// the default prometheus registry.
+type noopMetrics struct{}
+
+func (noopMetrics) ObserveDiscoveryDuration(cluster, component string, seconds float64) {}
+func (noopMetrics) IncResolveTotal(cluster, component, result string)                   {}
+func (noopMetrics) SetAddresses(cluster, component string, n int)                       {}
+func (noopMetrics) IncAddressChurn(cluster, component, change string)                   {}
@@ -0,0 +1,55 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolver
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	grpcresolver "google.golang.org/grpc/resolver"
+)
+
+func TestRecordAddressChurn(t *testing.T) {
+	r, _ := newTestResolver(Options{}, nil)
+
+	counts := map[string]int{}
+	r.metrics = &churnCountingMetrics{counts: counts}
+
+	previous := []grpcresolver.Address{{Addr: "a"}, {Addr: "b"}}
+	current := []grpcresolver.Address{{Addr: "b"}, {Addr: "c"}}
+
+	r.recordAddressChurn(previous, current)
+
+	assert.Equal(t, 1, counts["added"])
+	assert.Equal(t, 1, counts["removed"])
+}
+
+// churnCountingMetrics is a metricsCollector that only tracks
+// IncAddressChurn calls, for TestRecordAddressChurn.
+type churnCountingMetrics struct {
+	noopMetrics
+	m      sync.Mutex
+	counts map[string]int
+}
+
+func (c *churnCountingMetrics) IncAddressChurn(cluster, component, change string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.counts[change]++
+}
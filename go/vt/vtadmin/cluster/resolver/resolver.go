@@ -20,36 +20,41 @@ limitations under the License.
 // vtctlds and vtgates in a cluster being used by a grpc.ClientConn, allowing
 // VTAdmin to transparently reconnect to different vtctlds and vtgates both
 // periodically and when hosts are recycled.
-//
-// Some potential improvements we can add, if desired:
-//
-// 1. Background refresh. We would take a config flag that governs the refresh
-//	  interval and backoff (for when background refresh happens around the same
-//	  time as grpc-core calls to ResolveNow) and spin up a goroutine. We would
-//	  then have to spin this down when Close is called.
-//
-// 2. Stats!
 package resolver
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"math/rand"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/spf13/pflag"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/health/grpc_health_v1"
 	grpcresolver "google.golang.org/grpc/resolver"
 	"google.golang.org/grpc/serviceconfig"
 
 	"vitess.io/vitess/go/trace"
 	"vitess.io/vitess/go/vt/log"
-	"vitess.io/vitess/go/vt/vtadmin/cluster/discovery"
 	"vitess.io/vitess/go/vt/vtadmin/debug"
 )
 
 const logPrefix = "[vtadmin.cluster.resolver]"
 
+const (
+	// healthCheckFailureThreshold is the number of consecutive failed health
+	// probes after which an address is ejected from the resolved state.
+	healthCheckFailureThreshold = 3
+	// healthCheckEjectionCooldown is how long an ejected address is withheld
+	// from the resolved state before it becomes eligible for re-admission.
+	healthCheckEjectionCooldown = 30 * time.Second
+)
+
 type builder struct {
 	scheme string
 	opts   Options
@@ -75,17 +80,23 @@ const (
 	// PickFirstBalancer
 	PickFirstBalancer  BalancerPolicy = "pick_first"
 	RoundRobinBalancer BalancerPolicy = "round_robin"
+	// LocalityBalancer selects the vtadmin_locality balancer policy, which
+	// prefers SubConns whose "cell" BalancerAttribute matches
+	// Options.PreferredCell, falling back to round_robin across the
+	// remaining set. See balancer.go.
+	LocalityBalancer BalancerPolicy = LocalityBalancerName
 )
 
 var allBalancerPolicies = []string{ // convenience for help/error messages
 	string(PickFirstBalancer),
 	string(RoundRobinBalancer),
+	string(LocalityBalancer),
 }
 
 // Set is part of the pflag.Value interface.
 func (bp *BalancerPolicy) Set(s string) error {
 	switch s {
-	case string(PickFirstBalancer), string(RoundRobinBalancer):
+	case string(PickFirstBalancer), string(RoundRobinBalancer), string(LocalityBalancer):
 		*bp = BalancerPolicy(s)
 	default:
 		return fmt.Errorf("unsupported balancer policy %s; must be one of %s", s, strings.Join(allBalancerPolicies, ", "))
@@ -100,6 +111,25 @@ func (bp *BalancerPolicy) String() string { return string(*bp) }
 // Type is part of the pflag.Value interface.
 func (*BalancerPolicy) Type() string { return "resolver.BalancerPolicy" }
 
+// HostInfo is a discovered host address along with free-form locality
+// attributes (e.g. cell, keyspace-affinity, primary/replica hint) used to
+// populate grpcresolver.Address.Attributes and BalancerAttributes for
+// locality-aware balancing.
+type HostInfo struct {
+	Addr  string
+	Attrs map[string]string
+}
+
+// MetadataDiscovery is an optional interface a discovery.Discovery
+// implementation may additionally satisfy to advertise locality attributes
+// per discovered host. The resolver detects it via a type assertion against
+// the discovery.Discovery passed in Options, and falls back to the plain
+// DiscoverVtctldAddrs/DiscoverVTGateAddrs methods when unimplemented.
+type MetadataDiscovery interface {
+	DiscoverVtctldAddrsWithMetadata(ctx context.Context, tags []string) ([]HostInfo, error)
+	DiscoverVTGateAddrsWithMetadata(ctx context.Context, tags []string) ([]HostInfo, error)
+}
+
 // Options defines the configuration options that can produce a resolver.Builder.
 //
 // A builder may be produced directly from an Options struct, but the intended
@@ -107,11 +137,18 @@ func (*BalancerPolicy) Type() string { return "resolver.BalancerPolicy" }
 // ensures the Options have sensible defaults and both vtctldclient proxy and
 // VTGateProxy do.
 type Options struct {
-	// Discovery is the discovery implementation used to discover host addresses
-	// when the ClientConn requests an update from the resolver.
-	Discovery        discovery.Discovery
-	DiscoveryTags    []string
-	DiscoveryTimeout time.Duration
+	// DiscoverySources is the ordered, prioritized, weighted set of discovery
+	// backends used to discover host addresses when the ClientConn requests
+	// an update from the resolver. Populate directly, or via
+	// DiscoverySourceSpecs (parsed from --discovery-source) plus
+	// ResolveDiscoverySources.
+	DiscoverySources []DiscoverySource
+	// DiscoverySourceSpecs holds the name/priority/weight triples parsed
+	// from --discovery-source; pair with constructed discovery.Discovery
+	// backends via ResolveDiscoverySources before calling NewBuilder.
+	DiscoverySourceSpecs []DiscoverySourceSpec
+	DiscoveryTags        []string
+	DiscoveryTimeout     time.Duration
 
 	// BalancerPolicy, if set, will cause a resolver to provide a ServiceConfig
 	// to the resolver's ClientConn with a corresponding loadBalancingConfig.
@@ -120,6 +157,53 @@ type Options struct {
 	//
 	// For more details, see https://github.com/grpc/grpc/blob/master/doc/service_config.md.
 	BalancerPolicy BalancerPolicy
+
+	// DiscoveryMinRefreshInterval controls how often a resolver will
+	// background-refresh its address list, independent of grpc-core-driven
+	// ResolveNow calls. A zero value disables background refresh, and the
+	// resolver will only resolve in response to ResolveNow.
+	DiscoveryMinRefreshInterval time.Duration
+	// DiscoveryMaxRefreshInterval bounds the exponential backoff applied to
+	// the background refresh interval after repeated discovery errors. If
+	// unset, it defaults to DiscoveryMinRefreshInterval (i.e. no backoff).
+	DiscoveryMaxRefreshInterval time.Duration
+
+	// EnableHealthChecks, when set, causes the resolver to probe each
+	// discovered address with a grpc.health.v1.Health/Check call before
+	// publishing it to the ClientConn, and only include addresses that
+	// report SERVING. Addresses that fail repeatedly are temporarily
+	// ejected; see healthCheckFailureThreshold and healthCheckEjectionCooldown.
+	EnableHealthChecks bool
+	// HealthCheckTimeout bounds each per-address health probe.
+	HealthCheckTimeout time.Duration
+	// HealthCheckConcurrency caps how many addresses are probed in parallel
+	// during a single resolve. Defaults to 1 (sequential probing) if unset.
+	HealthCheckConcurrency int
+	// HealthCheckDialOptions are used to dial each address's health-check
+	// connection, and must be set (e.g. to grpc.WithTransportCredentials(...))
+	// whenever EnableHealthChecks is. There is no implicit insecure fallback:
+	// a cluster that genuinely has no TLS must still pass grpc.WithInsecure()
+	// explicitly here, since silently dialing insecurely would fail the
+	// handshake against any TLS-required cluster and eject every address.
+	// builder.build rejects EnableHealthChecks with this left empty.
+	HealthCheckDialOptions []grpc.DialOption
+
+	// PreferredCell is consulted by the vtadmin_locality BalancerPolicy (see
+	// LocalityBalancer) to prefer SubConns advertising a matching "cell"
+	// BalancerAttribute, falling back to round_robin across the remaining
+	// set when empty or unmatched.
+	PreferredCell string
+
+	// ServiceConfigProvider, if set, streams service config JSON updates
+	// that the resolver merges into its ClientConn without triggering a new
+	// address discovery cycle, taking precedence over the static
+	// BalancerPolicy-derived service config until the provider's Watch
+	// channel closes. Takes precedence over ServiceConfigSource.
+	ServiceConfigProvider ServiceConfigProvider
+	// ServiceConfigSource, if set, is parsed via NewServiceConfigProvider to
+	// construct a ServiceConfigProvider (e.g. "file:/path/to/config.json" or
+	// an "http://"/"https://" URL). Ignored if ServiceConfigProvider is set.
+	ServiceConfigSource string
 }
 
 // NewBuilder returns a gRPC resolver.Builder for the given scheme. For vtadmin,
@@ -149,6 +233,34 @@ func (opts *Options) InstallFlags(fs *pflag.FlagSet) {
 	fs.Var(&opts.BalancerPolicy, "grpc-balancer-policy",
 		fmt.Sprintf("Specify a load balancer policy to use for resolvers built by these options (the default grpc behavior is pick_first). Valid choices are %s",
 			strings.Join(allBalancerPolicies, ",")))
+	fs.DurationVar(&opts.DiscoveryMinRefreshInterval, "discovery-min-refresh-interval", 0,
+		"Minimum interval between background discovery refreshes. If zero, background refresh is disabled, "+
+			"and the resolver will only resolve in response to grpc-initiated ResolveNow calls.")
+	fs.DurationVar(&opts.DiscoveryMaxRefreshInterval, "discovery-max-refresh-interval", 0,
+		"Maximum interval between background discovery refreshes, used as the ceiling for exponential backoff "+
+			"after repeated discovery errors. Defaults to --discovery-min-refresh-interval (i.e. no backoff) if unset.")
+	fs.BoolVar(&opts.EnableHealthChecks, "discovery-enable-health-checks", false,
+		"Probe each discovered address with a grpc.health.v1.Health/Check call and only publish addresses that "+
+			"report SERVING, ejecting addresses that fail repeatedly.")
+	fs.DurationVar(&opts.HealthCheckTimeout, "discovery-health-check-timeout", 2*time.Second,
+		"Timeout to use for each per-address health probe. Only used if --discovery-enable-health-checks is set.")
+	fs.IntVar(&opts.HealthCheckConcurrency, "discovery-health-check-concurrency", 8,
+		"Maximum number of addresses to health-probe concurrently during a single resolve. Only used if "+
+			"--discovery-enable-health-checks is set.")
+	fs.StringVar(&opts.PreferredCell, "preferred-cell", "",
+		fmt.Sprintf("Cell to prefer when --grpc-balancer-policy=%s; SubConns outside this cell are only used "+
+			"as a round_robin fallback when no SubConn in the preferred cell is available.", LocalityBalancer))
+	fs.StringVar(&opts.ServiceConfigSource, "service-config-source", "",
+		"Optional source to watch for dynamic grpc service config updates (e.g. retry policy, method-level "+
+			"timeouts, loadBalancingConfig), applied without a new discovery cycle. Must be prefixed with "+
+			"file: for a local file, or http:// / https:// for a polled HTTP endpoint.")
+	fs.Var(&discoverySourceSpecsVar{specs: &opts.DiscoverySourceSpecs}, "discovery-source",
+		fmt.Sprintf("Repeatable. Registers a discovery source as name=<name>,priority=<n>,weight=<n> (weight "+
+			"defaults to 1 if omitted; only consulted by --grpc-balancer-policy=%s, see SourceWeightAttributeKey). "+
+			"Sources in lower-numbered priority tiers are queried first; a tier is only consulted once every "+
+			"source in every lower tier returns zero addresses or errors. Pair each named source with a "+
+			"constructed discovery.Discovery via Options.ResolveDiscoverySources before building a resolver.",
+			LocalityBalancer))
 }
 
 // Build is part of the resolver.Builder interface. See the commentary on
@@ -172,24 +284,68 @@ func (b *builder) Build(target grpcresolver.Target, cc grpcresolver.ClientConn,
 
 	r.ResolveNow(grpcresolver.ResolveNowOptions{})
 
+	if b.opts.DiscoveryMinRefreshInterval > 0 {
+		go r.refreshLoop()
+	}
+
+	if r.scProvider != nil {
+		go r.watchServiceConfig()
+	}
+
 	return r, nil
 }
 
 func (b *builder) build(target grpcresolver.Target, cc grpcresolver.ClientConn, opts grpcresolver.BuildOptions) (*resolver, error) {
-	var fn func(context.Context, []string) ([]string, error)
-	switch target.URL.Host {
-	case "vtctld":
-		fn = b.opts.Discovery.DiscoverVtctldAddrs
-	case "vtgate":
-		fn = b.opts.Discovery.DiscoverVTGateAddrs
-	default:
-		return nil, fmt.Errorf("%s: unsupported URL host %s", logPrefix, target.URL.Host)
+	if len(b.opts.DiscoverySources) == 0 {
+		return nil, fmt.Errorf("%s: no discovery sources configured", logPrefix)
+	}
+
+	if b.opts.EnableHealthChecks && len(b.opts.HealthCheckDialOptions) == 0 {
+		return nil, fmt.Errorf("%s: --discovery-enable-health-checks requires HealthCheckDialOptions to be set "+
+			"(e.g. to grpc.WithTransportCredentials(...), or explicitly to grpc.WithInsecure() for a cluster that "+
+			"really doesn't use TLS); otherwise every address would fail the health-check dial's TLS handshake "+
+			"and be ejected", logPrefix)
+	}
+
+	fetchers := make([]sourceFetcher, 0, len(b.opts.DiscoverySources))
+	statusBySource := make(map[string]*sourceStatus, len(b.opts.DiscoverySources))
+
+	for _, src := range b.opts.DiscoverySources {
+		fetch, err := hostInfoFetcher(src.Discovery, target.URL.Host)
+		if err != nil {
+			return nil, err
+		}
+
+		weight := src.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+
+		fetchers = append(fetchers, sourceFetcher{name: src.Name, weight: weight, priority: src.Priority, fetch: fetch})
+		statusBySource[src.Name] = &sourceStatus{}
 	}
 
+	sort.SliceStable(fetchers, func(i, j int) bool { return fetchers[i].priority < fetchers[j].priority })
+
 	var sc serviceconfig.Config
 	if b.opts.BalancerPolicy != "" {
+		// The vtadmin_locality policy is registered once, process-wide, with
+		// grpc-core, so its preferred cell is threaded through this
+		// per-ClientConn loadBalancingConfig entry (see localityBalancerConfig
+		// in balancer.go) rather than through a package-level var, which
+		// would otherwise be shared by every vtadmin cluster's resolver.
+		policyConfig := "{}"
+		if b.opts.BalancerPolicy == LocalityBalancer && b.opts.PreferredCell != "" {
+			policyConfigJSON, err := json.Marshal(localityBalancerConfig{PreferredCell: b.opts.PreferredCell})
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal %s balancer config: %w", LocalityBalancer, err)
+			}
+
+			policyConfig = string(policyConfigJSON)
+		}
+
 		// c.f. https://github.com/grpc/grpc/blob/master/doc/service_config.md#example
-		scpr := cc.ParseServiceConfig(fmt.Sprintf(`{"loadBalancingConfig": [{ "%s": {} }] }`, b.opts.BalancerPolicy))
+		scpr := cc.ParseServiceConfig(fmt.Sprintf(`{"loadBalancingConfig": [{ "%s": %s }] }`, b.opts.BalancerPolicy, policyConfig))
 		if scpr.Err != nil {
 			return nil, fmt.Errorf("failed to initialize service config with load balancer policy %s: %s", b.opts.BalancerPolicy, scpr.Err)
 		}
@@ -197,18 +353,31 @@ func (b *builder) build(target grpcresolver.Target, cc grpcresolver.ClientConn,
 		sc = scpr.Config
 	}
 
+	scProvider := b.opts.ServiceConfigProvider
+	if scProvider == nil && b.opts.ServiceConfigSource != "" {
+		var err error
+		scProvider, err = NewServiceConfigProvider(b.opts.ServiceConfigSource)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &resolver{
-		component:     target.URL.Host,
-		cluster:       target.URL.Scheme,
-		discoverAddrs: fn,
-		opts:          b.opts,
-		cc:            cc,
-		sc:            sc,
-		ctx:           ctx,
-		cancel:        cancel,
-		createdAt:     time.Now().UTC(),
+		component:      target.URL.Host,
+		cluster:        target.URL.Scheme,
+		sourceFetchers: fetchers,
+		sourceStatus:   statusBySource,
+		opts:           b.opts,
+		cc:             cc,
+		sc:             sc,
+		scProvider:     scProvider,
+		ctx:            ctx,
+		cancel:         cancel,
+		createdAt:      time.Now().UTC(),
+		healthStats:    make(map[string]*addrHealthStats),
+		metrics:        promMetrics{},
 	}, nil
 }
 
@@ -238,25 +407,171 @@ func (b *builder) Debug() map[string]any {
 }
 
 type resolver struct {
-	component     string
-	cluster       string
-	discoverAddrs func(ctx context.Context, tags []string) ([]string, error)
-	opts          Options
+	component string
+	cluster   string
+	// sourceFetchers is the resolved, per-component fetch function for each
+	// configured DiscoverySource, sorted ascending by priority; see
+	// discoverAddrs and discovery_sources.go.
+	sourceFetchers []sourceFetcher
+	opts           Options
 
 	cc grpcresolver.ClientConn
 	sc serviceconfig.Config // optionally used to enforce a balancer policy
 
+	// scProvider, if set, streams dynamic service config updates; see
+	// watchServiceConfig and service_config.go.
+	scProvider ServiceConfigProvider
+	// dynamicServiceConfig is the most recent config pushed by scProvider, if
+	// any, and takes precedence over sc in resolve. Guarded by m.
+	dynamicServiceConfig *serviceconfig.ParseResult
+
 	ctx    context.Context
 	cancel context.CancelFunc
 
-	// for debug.Debuggable
-	// TODO: consider proper exported stats - histograms for timings, error rates, etc.
+	// metrics receives the prometheus-exported resolve/discovery stats; see
+	// metrics.go. Defaults to promMetrics, but tests may substitute noopMetrics.
+	metrics metricsCollector
 
+	// for debug.Debuggable
 	m                sync.Mutex
 	createdAt        time.Time
 	lastResolvedAt   time.Time
 	lastResolveError error
 	lastAddrs        []grpcresolver.Address
+
+	// resolving coalesces concurrent resolve attempts (from ResolveNow and the
+	// background refresh loop) so only one discovery lookup is in flight at a
+	// time; a caller that finds resolving already true returns immediately
+	// rather than duplicating the lookup.
+	resolving     bool
+	nextRefreshAt time.Time
+
+	// healthStats tracks per-address health probe outcomes, keyed by addr,
+	// when opts.EnableHealthChecks is set. Guarded by m.
+	healthStats map[string]*addrHealthStats
+
+	// sourceStatus tracks the most recent outcome of querying each
+	// DiscoverySource by name, surfaced in Debug(). Guarded by m.
+	sourceStatus map[string]*sourceStatus
+}
+
+// sourceStatus tracks the most recent outcome of querying a single
+// DiscoverySource, used to drive priority failover and surfaced in Debug().
+type sourceStatus struct {
+	lastSuccessAt time.Time
+	lastError     error
+	addressCount  int
+}
+
+// addrHealthStats tracks the health-probe outcome history for a single
+// discovered address, used to drive outlier ejection.
+type addrHealthStats struct {
+	successCount        int
+	consecutiveFailures int
+	lastError           error
+	ejectedUntil        time.Time
+}
+
+// discoverAddrs queries r.sourceFetchers in priority order (lowest first),
+// returning the union of addresses from the first tier that yields at least
+// one address. All sources within a tier are queried in parallel. A tier
+// that yields no addresses - whether every source errored, or every source
+// simply returned none - falls through to the next priority tier.
+func (r *resolver) discoverAddrs(ctx context.Context, tags []string) ([]HostInfo, error) {
+	var lastErr error
+
+	for _, tier := range groupByPriority(r.sourceFetchers) {
+		hosts, err := r.queryTier(ctx, tier, tags)
+		if len(hosts) > 0 {
+			return hosts, nil
+		}
+
+		if err != nil {
+			lastErr = err
+		}
+	}
+
+	return nil, lastErr
+}
+
+// queryTier queries every source in tier concurrently, recording per-source
+// status, and returns the deduplicated union of their addresses, each
+// annotated with its source's configured weight via SourceWeightAttributeKey
+// (see withSourceWeight) for the vtadmin_locality balancer to consume. The
+// returned error is non-nil only if every source in tier errored.
+func (r *resolver) queryTier(ctx context.Context, tier []sourceFetcher, tags []string) ([]HostInfo, error) {
+	type result struct {
+		fetcher sourceFetcher
+		hosts   []HostInfo
+		err     error
+	}
+
+	results := make(chan result, len(tier))
+	for _, f := range tier {
+		f := f
+		go func() {
+			hosts, err := f.fetch(ctx, tags)
+			results <- result{fetcher: f, hosts: hosts, err: err}
+		}()
+	}
+
+	var (
+		union   []HostInfo
+		lastErr error
+		numErrs int
+	)
+
+	seen := make(map[string]bool)
+
+	for range tier {
+		res := <-results
+		r.recordSourceStatus(res.fetcher.name, res.hosts, res.err)
+
+		if res.err != nil {
+			lastErr = res.err
+			numErrs++
+			continue
+		}
+
+		for _, host := range res.hosts {
+			// Dedup by Addr across sources in the same tier: otherwise two
+			// sources both returning the same address produce two HostInfos
+			// differing only in their source_weight attribute, which grpc's
+			// Address+Attributes dedup does not collapse, resulting in two
+			// SubConns to one backend instead of one.
+			if seen[host.Addr] {
+				continue
+			}
+
+			seen[host.Addr] = true
+			union = append(union, withSourceWeight(host, res.fetcher.weight))
+		}
+	}
+
+	if numErrs == len(tier) {
+		return union, lastErr
+	}
+
+	return union, nil
+}
+
+// recordSourceStatus updates r.sourceStatus[name] with the outcome of a
+// single discovery.Discovery query against that source.
+func (r *resolver) recordSourceStatus(name string, hosts []HostInfo, err error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	status, ok := r.sourceStatus[name]
+	if !ok {
+		status = &sourceStatus{}
+		r.sourceStatus[name] = status
+	}
+
+	status.lastError = err
+	if err == nil {
+		status.lastSuccessAt = time.Now().UTC()
+		status.addressCount = len(hosts)
+	}
 }
 
 func (r *resolver) resolve() (*grpcresolver.State, error) {
@@ -271,72 +586,437 @@ func (r *resolver) resolve() (*grpcresolver.State, error) {
 	ctx, cancel := context.WithTimeout(ctx, r.opts.DiscoveryTimeout)
 	defer cancel()
 
-	addrs, err := r.discoverAddrs(ctx, r.opts.DiscoveryTags)
+	discoveryStart := time.Now()
+	hosts, err := r.discoverAddrs(ctx, r.opts.DiscoveryTags)
+	r.metrics.ObserveDiscoveryDuration(r.cluster, r.component, time.Since(discoveryStart).Seconds())
 	if err != nil {
 		return nil, fmt.Errorf("failed to discover %ss (cluster %s): %w", r.component, r.cluster, err)
 	}
 
+	if r.opts.EnableHealthChecks {
+		// Health probes run against r.ctx directly, for cancellation only: it
+		// must not carry a timeout of its own. checkHealth already applies
+		// HealthCheckTimeout per address, but filterHealthyAddrs only probes
+		// HealthCheckConcurrency addresses at a time, so with more hosts than
+		// that a single shared, time-bounded ctx would leave later waves
+		// probing against an already-near-expired deadline inherited from
+		// the first wave, starving otherwise-healthy hosts into ejection.
+		hosts = r.filterHealthyAddrs(r.ctx, hosts)
+	}
+
+	addrs := make([]string, len(hosts))
+	for i, host := range hosts {
+		addrs[i] = host.Addr
+	}
 	span.Annotate("addrs", strings.Join(addrs, ","))
 
 	state := &grpcresolver.State{
-		Addresses: make([]grpcresolver.Address, len(addrs)),
+		Addresses: make([]grpcresolver.Address, len(hosts)),
 	}
 
-	if r.sc != nil {
+	r.m.Lock()
+	dynamicSC := r.dynamicServiceConfig
+	r.m.Unlock()
+
+	switch {
+	case dynamicSC != nil:
+		span.Annotate("service_config_source", "dynamic")
+		state.ServiceConfig = dynamicSC
+	case r.sc != nil:
 		span.Annotate("balancer_policy", r.opts.BalancerPolicy)
 		state.ServiceConfig = &serviceconfig.ParseResult{
 			Config: r.sc,
 		}
 	}
 
-	for i, addr := range addrs {
-		state.Addresses[i] = grpcresolver.Address{
-			Addr: addr,
+	for i, host := range hosts {
+		addr := grpcresolver.Address{Addr: host.Addr}
+		if attrs := attributesFromHostInfo(host); attrs != nil {
+			addr.Attributes = attrs
+			addr.BalancerAttributes = attrs
 		}
+
+		state.Addresses[i] = addr
 	}
 
 	return state, nil
 }
 
+// attributesFromHostInfo builds a grpc attributes.Attributes bag from a
+// HostInfo's Attrs map, for use as both Address.Attributes (consulted by
+// grpc-core, e.g. for deduplication) and Address.BalancerAttributes
+// (consulted only by the balancer policy). Returns nil if host carries no
+// attributes.
+func attributesFromHostInfo(host HostInfo) *attributes.Attributes {
+	if len(host.Attrs) == 0 {
+		return nil
+	}
+
+	var attrs *attributes.Attributes
+	for k, v := range host.Attrs {
+		if attrs == nil {
+			attrs = attributes.New(k, v)
+		} else {
+			attrs = attrs.WithValue(k, v)
+		}
+	}
+
+	return attrs
+}
+
+// filterHealthyAddrs probes each distinct address in hosts with a
+// grpc.health.v1.Health/Check call, bounded by opts.HealthCheckConcurrency,
+// and returns only those that report SERVING and are not currently under
+// sticky ejection (see probeAddr). hosts is deduplicated by Addr first as a
+// defensive measure (queryTier already dedups within a tier, but this guards
+// any future caller that doesn't): probing the same address concurrently
+// with itself would corrupt the single addrHealthStats.consecutiveFailures
+// counter tracked per-address, tripping healthCheckFailureThreshold within
+// one resolve instead of across independent resolve cycles as intended.
+func (r *resolver) filterHealthyAddrs(ctx context.Context, hosts []HostInfo) []HostInfo {
+	type result struct {
+		host    HostInfo
+		healthy bool
+	}
+
+	deduped := make([]HostInfo, 0, len(hosts))
+	seen := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		if seen[host.Addr] {
+			continue
+		}
+
+		seen[host.Addr] = true
+		deduped = append(deduped, host)
+	}
+
+	concurrency := r.opts.HealthCheckConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	sem := make(chan struct{}, concurrency)
+	results := make(chan result, len(deduped))
+
+	for _, host := range deduped {
+		host := host
+
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem }()
+			results <- result{host: host, healthy: r.probeAddr(ctx, host.Addr)}
+		}()
+	}
+
+	healthy := make([]HostInfo, 0, len(deduped))
+	for range deduped {
+		res := <-results
+		if res.healthy {
+			healthy = append(healthy, res.host)
+		}
+	}
+
+	return healthy
+}
+
+// probeAddr reports whether addr should be published to the ClientConn. An
+// address still within its ejection cooldown is treated as unhealthy without
+// re-probing (sticky ejection); otherwise it is probed via Health/Check and
+// consecutive-failure/ejection bookkeeping in r.healthStats is updated.
+func (r *resolver) probeAddr(ctx context.Context, addr string) bool {
+	r.m.Lock()
+	stats, ok := r.healthStats[addr]
+	if !ok {
+		stats = &addrHealthStats{}
+		r.healthStats[addr] = stats
+	}
+	ejected := !stats.ejectedUntil.IsZero() && time.Now().UTC().Before(stats.ejectedUntil)
+	r.m.Unlock()
+
+	if ejected {
+		return false
+	}
+
+	healthy, err := r.checkHealth(ctx, addr)
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	stats.lastError = err
+	if healthy {
+		stats.successCount++
+		stats.consecutiveFailures = 0
+		stats.ejectedUntil = time.Time{}
+	} else {
+		stats.consecutiveFailures++
+		if stats.consecutiveFailures >= healthCheckFailureThreshold {
+			stats.ejectedUntil = time.Now().UTC().Add(healthCheckEjectionCooldown)
+		}
+	}
+
+	return healthy
+}
+
+// checkHealth dials addr and issues a single grpc.health.v1.Health/Check,
+// reporting whether the service responded SERVING within opts.HealthCheckTimeout.
+func (r *resolver) checkHealth(ctx context.Context, addr string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.opts.HealthCheckTimeout)
+	defer cancel()
+
+	// builder.build rejects EnableHealthChecks with no HealthCheckDialOptions
+	// at construction time, so r.opts.HealthCheckDialOptions is always
+	// non-empty here; there is no implicit insecure fallback.
+	dialOpts := make([]grpc.DialOption, 0, len(r.opts.HealthCheckDialOptions)+1)
+	dialOpts = append(dialOpts, r.opts.HealthCheckDialOptions...)
+	dialOpts = append(dialOpts, grpc.WithBlock())
+
+	conn, err := grpc.DialContext(ctx, addr, dialOpts...)
+	if err != nil {
+		return false, fmt.Errorf("failed to dial %s for health check: %w", addr, err)
+	}
+	defer conn.Close()
+
+	resp, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		return false, fmt.Errorf("health check failed for %s: %w", addr, err)
+	}
+
+	return resp.GetStatus() == grpc_health_v1.HealthCheckResponse_SERVING, nil
+}
+
 // ResolveNow is part of the resolver.Resolver interface. It is called by grpc
 // ClientConn's when errors occur, as well as periodically to refresh the set of
 // addresses a ClientConn can use for SubConns.
 func (r *resolver) ResolveNow(o grpcresolver.ResolveNowOptions) {
+	r.maybeResolve()
+}
+
+// refreshLoop runs as its own goroutine, started from builder.Build when
+// background refresh is enabled, and periodically triggers a resolve on an
+// interval controlled by opts.Discovery{Min,Max}RefreshInterval. Repeated
+// discovery errors push the un-jittered backoff base toward the max via
+// exponential backoff, and the actual sleep is a full-jitter draw over that
+// base (mirroring etcd's clientv3 balancer and the AWS full-jitter
+// algorithm), so a whole unreachable endpoint pool does not cause
+// synchronized rediscovery storms. base is tracked separately from the
+// jittered sleep duration: feeding the jittered value back into the next
+// doubling would let a low jitter draw shrink the base, so the interval
+// random-walks near the floor instead of climbing toward max. Backoff only
+// advances or resets in response to a resolve this loop itself ran:
+// grpc-core fires ResolveNow on every connection error, and during an outage
+// those calls can coalesce with (i.e. win the race against) this loop's own
+// tick via r.resolving, which reports no error despite nothing having
+// actually resolved. Treating that as a success would keep resetting the
+// interval to the floor for as long as grpc-core keeps calling ResolveNow,
+// defeating the backoff entirely. It exits when Close cancels r.ctx.
+func (r *resolver) refreshLoop() {
+	floor := r.opts.DiscoveryMinRefreshInterval
+	base := floor
+	interval := base
+
 	r.m.Lock()
-	defer r.m.Unlock()
+	r.nextRefreshAt = time.Now().UTC().Add(interval)
+	r.m.Unlock()
 
-	var (
-		state *grpcresolver.State
-		err   error
-	)
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		if ran, err := r.maybeResolve(); ran {
+			if err != nil {
+				base = nextBackoffBase(base, r.refreshMaxInterval())
+			} else {
+				base = floor
+			}
+		}
+
+		interval = fullJitter(base, floor)
 
+		r.m.Lock()
+		r.nextRefreshAt = time.Now().UTC().Add(interval)
+		r.m.Unlock()
+
+		timer.Reset(interval)
+	}
+}
+
+// watchServiceConfig runs as its own goroutine, started from builder.Build
+// when opts.ServiceConfigProvider/ServiceConfigSource is configured. Each
+// update from scProvider.Watch is applied directly via applyServiceConfig,
+// without triggering a new address discovery cycle. If the provider's
+// channel closes (the source disappeared) before r.ctx is done, the resolver
+// reverts to its static BalancerPolicy-derived service config.
+func (r *resolver) watchServiceConfig() {
+	ch := r.scProvider.Watch(r.ctx)
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case raw, ok := <-ch:
+			if !ok {
+				log.Warningf("%s: service config source closed for %s (cluster %s); reverting to static balancer policy", logPrefix, r.component, r.cluster)
+				r.applyServiceConfig(nil)
+				return
+			}
+
+			scpr := r.cc.ParseServiceConfig(raw)
+			if scpr.Err != nil {
+				log.Errorf("%s: failed to parse dynamic service config for %s (cluster %s): %s", logPrefix, r.component, r.cluster, scpr.Err)
+				continue
+			}
+
+			r.applyServiceConfig(scpr)
+		}
+	}
+}
+
+// applyServiceConfig records scpr as the dynamic service config override (or
+// clears it, falling back to the static BalancerPolicy-derived config, if
+// scpr is nil) and immediately pushes it to the ClientConn alongside the
+// last-resolved addresses, without performing a new discovery lookup.
+func (r *resolver) applyServiceConfig(scpr *serviceconfig.ParseResult) {
+	r.m.Lock()
+	r.dynamicServiceConfig = scpr
+	if scpr == nil && r.sc != nil {
+		scpr = &serviceconfig.ParseResult{Config: r.sc}
+	}
+	state := grpcresolver.State{
+		Addresses:     r.lastAddrs,
+		ServiceConfig: scpr,
+	}
+	r.m.Unlock()
+
+	if err := r.cc.UpdateState(state); err != nil {
+		log.Errorf("%s: failed to apply service config update for %s (cluster %s): %s", logPrefix, r.component, r.cluster, err)
+		r.cc.ReportError(err)
+	}
+}
+
+// refreshMaxInterval returns the configured max refresh interval, falling
+// back to the min interval (i.e. no backoff) when unset.
+func (r *resolver) refreshMaxInterval() time.Duration {
+	if r.opts.DiscoveryMaxRefreshInterval > 0 {
+		return r.opts.DiscoveryMaxRefreshInterval
+	}
+
+	return r.opts.DiscoveryMinRefreshInterval
+}
+
+// nextBackoffBase doubles base, capped at max. The result is the un-jittered
+// backoff base for the next round; see fullJitter for the sleep actually
+// used.
+func nextBackoffBase(base, max time.Duration) time.Duration {
+	next := base * 2
+	if next <= 0 || next > max {
+		next = max
+	}
+
+	return next
+}
+
+// fullJitter returns a random duration in [floor, base], per the AWS/etcd
+// full-jitter algorithm, so concurrently-backing-off resolvers don't all
+// rediscover at once. base is always >= floor (refreshLoop never lowers base
+// below floor), so rand.Int63n is never called with a non-positive argument.
+func fullJitter(base, floor time.Duration) time.Duration {
+	if base <= floor {
+		return floor
+	}
+
+	return floor + time.Duration(rand.Int63n(int64(base-floor)))
+}
+
+// maybeResolve performs a resolve-and-update cycle, returning whether it
+// actually ran one, and the error (if any) from either the discovery lookup
+// or the subsequent UpdateState call. It coalesces with any resolve already
+// in flight, whether triggered by a concurrent ResolveNow or the background
+// refresh loop: a caller that finds one already running returns immediately,
+// with ran=false, instead of issuing a duplicate discovery lookup. Callers
+// that make backoff decisions (refreshLoop) must check ran: a coalesced call
+// says nothing about whether discovery is succeeding, so it must not be
+// treated as either a success or a failure.
+func (r *resolver) maybeResolve() (ran bool, err error) {
+	r.m.Lock()
+	if r.resolving {
+		r.m.Unlock()
+		return false, nil
+	}
+
+	r.resolving = true
 	r.lastResolvedAt = time.Now().UTC()
+	r.m.Unlock()
+
 	defer func() {
-		r.lastResolveError = err
-		if state != nil {
-			r.lastAddrs = state.Addresses
-		}
+		r.m.Lock()
+		r.resolving = false
+		r.m.Unlock()
 	}()
 
-	state, err = r.resolve()
+	state, err := r.resolve()
+
+	r.m.Lock()
+	r.lastResolveError = err
+	previousAddrs := r.lastAddrs
+	if state != nil {
+		r.lastAddrs = state.Addresses
+	}
+	r.m.Unlock()
+
 	if err != nil {
 		log.Errorf("%s: failed to resolve new addresses for %s (cluster %s): %s", logPrefix, r.component, r.cluster, err)
+		r.metrics.IncResolveTotal(r.cluster, r.component, "error")
 		r.cc.ReportError(err)
-		return
+		return true, err
 	}
 
 	switch len(state.Addresses) {
 	case 0:
 		log.Warningf("%s: found no %ss (cluster %s); updating grpc clientconn state anyway", logPrefix, r.component, r.cluster)
+		r.metrics.IncResolveTotal(r.cluster, r.component, "empty")
 	default:
 		log.Infof("%s: found %d %ss (cluster %s)", logPrefix, len(state.Addresses), r.component, r.cluster)
+		r.metrics.IncResolveTotal(r.cluster, r.component, "success")
 	}
 
-	err = r.cc.UpdateState(*state)
-	if err != nil {
-		log.Errorf("%s: failed to update %ss addresses for %s (cluster %s): %s", logPrefix, r.component, r.cluster, err)
+	r.metrics.SetAddresses(r.cluster, r.component, len(state.Addresses))
+	r.recordAddressChurn(previousAddrs, state.Addresses)
+
+	if err := r.cc.UpdateState(*state); err != nil {
+		log.Errorf("%s: failed to update %ss addresses (cluster %s): %s", logPrefix, r.component, r.cluster, err)
 		r.cc.ReportError(err)
-		return
+		return true, err
+	}
+
+	return true, nil
+}
+
+// recordAddressChurn diffs previous against current by address string and
+// emits an address_churn_total increment for each addition and removal.
+func (r *resolver) recordAddressChurn(previous, current []grpcresolver.Address) {
+	previousSet := make(map[string]bool, len(previous))
+	for _, addr := range previous {
+		previousSet[addr.Addr] = true
+	}
+
+	currentSet := make(map[string]bool, len(current))
+	for _, addr := range current {
+		currentSet[addr.Addr] = true
+		if !previousSet[addr.Addr] {
+			r.metrics.IncAddressChurn(r.cluster, r.component, "added")
+		}
+	}
+
+	for addr := range previousSet {
+		if !currentSet[addr] {
+			r.metrics.IncAddressChurn(r.cluster, r.component, "removed")
+		}
 	}
 }
 
@@ -361,9 +1041,57 @@ func (r *resolver) Debug() map[string]any {
 		m["last_resolved_at"] = debug.TimeToString(r.lastResolvedAt)
 	}
 
+	if !r.nextRefreshAt.IsZero() {
+		m["next_refresh_at"] = debug.TimeToString(r.nextRefreshAt)
+	}
+
+	m["dynamic_service_config"] = r.dynamicServiceConfig != nil
+
 	if r.lastResolveError != nil {
 		m["error"] = r.lastResolveError.Error()
 	}
 
+	if len(r.healthStats) > 0 {
+		healthStats := make(map[string]map[string]any, len(r.healthStats))
+		for addr, stats := range r.healthStats {
+			s := map[string]any{
+				"success_count":        stats.successCount,
+				"consecutive_failures": stats.consecutiveFailures,
+				"ejected":              !stats.ejectedUntil.IsZero() && time.Now().UTC().Before(stats.ejectedUntil),
+			}
+
+			if !stats.ejectedUntil.IsZero() {
+				s["ejected_until"] = debug.TimeToString(stats.ejectedUntil)
+			}
+
+			if stats.lastError != nil {
+				s["last_error"] = stats.lastError.Error()
+			}
+
+			healthStats[addr] = s
+		}
+
+		m["health_checks"] = healthStats
+	}
+
+	if len(r.sourceStatus) > 0 {
+		sources := make(map[string]map[string]any, len(r.sourceStatus))
+		for name, status := range r.sourceStatus {
+			s := map[string]any{"address_count": status.addressCount}
+
+			if !status.lastSuccessAt.IsZero() {
+				s["last_success_at"] = debug.TimeToString(status.lastSuccessAt)
+			}
+
+			if status.lastError != nil {
+				s["last_error"] = status.lastError.Error()
+			}
+
+			sources[name] = s
+		}
+
+		m["discovery_sources"] = sources
+	}
+
 	return m
 }
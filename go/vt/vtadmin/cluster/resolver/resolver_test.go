@@ -0,0 +1,197 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolver
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	grpcresolver "google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+// fakeClientConn is a minimal grpcresolver.ClientConn recording the states
+// and errors a resolver pushes to it, for use across this package's tests.
+type fakeClientConn struct {
+	m         sync.Mutex
+	states    []grpcresolver.State
+	errs      []error
+	updateErr error
+}
+
+func (f *fakeClientConn) UpdateState(s grpcresolver.State) error {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.states = append(f.states, s)
+	return f.updateErr
+}
+
+func (f *fakeClientConn) ReportError(err error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.errs = append(f.errs, err)
+}
+
+func (f *fakeClientConn) NewAddress(addresses []grpcresolver.Address) {}
+func (f *fakeClientConn) NewServiceConfig(serviceConfig string)       {}
+
+func (f *fakeClientConn) ParseServiceConfig(js string) *serviceconfig.ParseResult {
+	return &serviceconfig.ParseResult{}
+}
+
+func (f *fakeClientConn) lastState() grpcresolver.State {
+	f.m.Lock()
+	defer f.m.Unlock()
+	return f.states[len(f.states)-1]
+}
+
+func (f *fakeClientConn) stateCount() int {
+	f.m.Lock()
+	defer f.m.Unlock()
+	return len(f.states)
+}
+
+// newTestResolver builds a resolver directly (bypassing builder.build, which
+// requires a real discovery.Discovery), wired up with fetcher(s) and a
+// fakeClientConn, ready to exercise resolve/maybeResolve/refreshLoop.
+func newTestResolver(opts Options, fetchers []sourceFetcher) (*resolver, *fakeClientConn) {
+	cc := &fakeClientConn{}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r := &resolver{
+		component:      "vtgate",
+		cluster:        "test",
+		sourceFetchers: fetchers,
+		sourceStatus:   make(map[string]*sourceStatus, len(fetchers)),
+		opts:           opts,
+		cc:             cc,
+		ctx:            ctx,
+		cancel:         cancel,
+		createdAt:      time.Now().UTC(),
+		healthStats:    make(map[string]*addrHealthStats),
+		metrics:        noopMetrics{},
+	}
+
+	for _, f := range fetchers {
+		r.sourceStatus[f.name] = &sourceStatus{}
+	}
+
+	return r, cc
+}
+
+func fetcherReturning(name string, priority int, hosts []HostInfo, err error) sourceFetcher {
+	return sourceFetcher{
+		name:     name,
+		weight:   1,
+		priority: priority,
+		fetch: func(context.Context, []string) ([]HostInfo, error) {
+			return hosts, err
+		},
+	}
+}
+
+func TestNextBackoffBase(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     time.Duration
+		max      time.Duration
+		expected time.Duration
+	}{
+		{"doubles under cap", time.Second, time.Minute, 2 * time.Second},
+		{"caps at max", 40 * time.Second, time.Minute, time.Minute},
+		{"caps on overflow", time.Duration(1) << 62, time.Minute, time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, nextBackoffBase(tt.base, tt.max))
+		})
+	}
+}
+
+func TestFullJitter(t *testing.T) {
+	t.Run("base at or below floor returns floor", func(t *testing.T) {
+		assert.Equal(t, time.Second, fullJitter(time.Second, time.Second))
+		assert.Equal(t, time.Second, fullJitter(500*time.Millisecond, time.Second))
+	})
+
+	t.Run("result always within [floor, base]", func(t *testing.T) {
+		floor := 100 * time.Millisecond
+		base := 10 * time.Second
+
+		for i := 0; i < 200; i++ {
+			got := fullJitter(base, floor)
+			assert.GreaterOrEqual(t, got, floor)
+			assert.LessOrEqual(t, got, base)
+		}
+	})
+}
+
+func TestMaybeResolve_CoalescesConcurrentCalls(t *testing.T) {
+	var (
+		m          sync.Mutex
+		fetchCount int
+	)
+	block := make(chan struct{})
+
+	fetchers := []sourceFetcher{{
+		name:     "slow",
+		weight:   1,
+		priority: 0,
+		fetch: func(context.Context, []string) ([]HostInfo, error) {
+			m.Lock()
+			fetchCount++
+			m.Unlock()
+			<-block
+			return []HostInfo{{Addr: "10.0.0.1:15999"}}, nil
+		},
+	}}
+
+	r, cc := newTestResolver(Options{DiscoveryTimeout: time.Second}, fetchers)
+
+	var wg sync.WaitGroup
+	results := make([]bool, 2)
+	for i := 0; i < 2; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ran, _ := r.maybeResolve()
+			results[i] = ran
+		}()
+	}
+
+	// Give the first call time to grab r.resolving before releasing both.
+	time.Sleep(50 * time.Millisecond)
+	close(block)
+	wg.Wait()
+
+	ranCount := 0
+	for _, ran := range results {
+		if ran {
+			ranCount++
+		}
+	}
+
+	assert.Equal(t, 1, ranCount, "only one concurrent maybeResolve call should actually resolve")
+	assert.Equal(t, 1, fetchCount, "a coalesced call must not trigger a second discovery lookup")
+	assert.Equal(t, 1, cc.stateCount())
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"vitess.io/vitess/go/vt/log"
+)
+
+// defaultServiceConfigPollInterval is used by FileServiceConfigProvider and
+// HTTPServiceConfigProvider when PollInterval is unset.
+const defaultServiceConfigPollInterval = 30 * time.Second
+
+// ServiceConfigProvider streams raw grpc service config JSON documents for a
+// resolver to apply to its ClientConn via UpdateState, without requiring a
+// new address discovery cycle. Watch should push a value whenever the config
+// changes, and close its channel if ctx is cancelled or the underlying source
+// disappears; the resolver treats an unexpected close as a signal to fall
+// back to the static BalancerPolicy-derived service config.
+type ServiceConfigProvider interface {
+	Watch(ctx context.Context) <-chan string
+}
+
+// NewServiceConfigProvider constructs a ServiceConfigProvider from a
+// --service-config-source value: "file:/path/to/config.json" yields a
+// FileServiceConfigProvider, and an "http://" or "https://" URL yields an
+// HTTPServiceConfigProvider.
+func NewServiceConfigProvider(source string) (ServiceConfigProvider, error) {
+	switch {
+	case strings.HasPrefix(source, "file:"):
+		return &FileServiceConfigProvider{Path: strings.TrimPrefix(source, "file:")}, nil
+	case strings.HasPrefix(source, "http://"), strings.HasPrefix(source, "https://"):
+		return &HTTPServiceConfigProvider{URL: source}, nil
+	default:
+		return nil, fmt.Errorf("unsupported service config source %q; must be prefixed with file: or http(s)://", source)
+	}
+}
+
+// FileServiceConfigProvider is a ServiceConfigProvider that polls a local
+// file for service config JSON, pushing its contents whenever they change.
+// Its Watch channel closes once the file no longer exists; other read errors
+// are logged and polling continues.
+type FileServiceConfigProvider struct {
+	Path string
+	// PollInterval defaults to defaultServiceConfigPollInterval if unset.
+	PollInterval time.Duration
+}
+
+// Watch is part of the ServiceConfigProvider interface.
+func (p *FileServiceConfigProvider) Watch(ctx context.Context) <-chan string {
+	ch := make(chan string)
+	go p.watch(ctx, ch)
+	return ch
+}
+
+func (p *FileServiceConfigProvider) watch(ctx context.Context, ch chan<- string) {
+	defer close(ch)
+
+	interval := p.PollInterval
+	if interval <= 0 {
+		interval = defaultServiceConfigPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last string
+	for {
+		contents, err := os.ReadFile(p.Path)
+		switch {
+		case os.IsNotExist(err):
+			log.Warningf("%s: service config file %s no longer exists; closing watch", logPrefix, p.Path)
+			return
+		case err != nil:
+			log.Warningf("%s: failed to read service config file %s: %s", logPrefix, p.Path, err)
+		case string(contents) != last:
+			last = string(contents)
+			select {
+			case ch <- last:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// HTTPServiceConfigProvider is a ServiceConfigProvider that polls an HTTP(S)
+// endpoint for service config JSON, pushing the response body whenever it
+// changes. Fetch errors, including non-200 responses, are logged and polling
+// continues; its Watch channel closes only when ctx is done, so it never
+// reports the endpoint as gone.
+type HTTPServiceConfigProvider struct {
+	URL string
+	// PollInterval defaults to defaultServiceConfigPollInterval if unset.
+	PollInterval time.Duration
+	// Client defaults to http.DefaultClient if unset.
+	Client *http.Client
+}
+
+// Watch is part of the ServiceConfigProvider interface.
+func (p *HTTPServiceConfigProvider) Watch(ctx context.Context) <-chan string {
+	ch := make(chan string)
+	go p.watch(ctx, ch)
+	return ch
+}
+
+func (p *HTTPServiceConfigProvider) watch(ctx context.Context, ch chan<- string) {
+	defer close(ch)
+
+	interval := p.PollInterval
+	if interval <= 0 {
+		interval = defaultServiceConfigPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last string
+	for {
+		body, err := p.fetch(ctx)
+		switch {
+		case err != nil:
+			log.Warningf("%s: failed to fetch service config from %s: %s", logPrefix, p.URL, err)
+		case body != last:
+			last = body
+			select {
+			case ch <- last:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *HTTPServiceConfigProvider) fetch(ctx context.Context) (string, error) {
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s fetching %s", resp.Status, p.URL)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return string(body), nil
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewServiceConfigProvider(t *testing.T) {
+	t.Run("file source", func(t *testing.T) {
+		p, err := NewServiceConfigProvider("file:/tmp/config.json")
+		require.NoError(t, err)
+		fp, ok := p.(*FileServiceConfigProvider)
+		require.True(t, ok)
+		assert.Equal(t, "/tmp/config.json", fp.Path)
+	})
+
+	t.Run("http source", func(t *testing.T) {
+		p, err := NewServiceConfigProvider("http://example.test/config.json")
+		require.NoError(t, err)
+		hp, ok := p.(*HTTPServiceConfigProvider)
+		require.True(t, ok)
+		assert.Equal(t, "http://example.test/config.json", hp.URL)
+	})
+
+	t.Run("unsupported source", func(t *testing.T) {
+		_, err := NewServiceConfigProvider("consul://config")
+		assert.Error(t, err)
+	})
+}
+
+func TestFileServiceConfigProvider_Watch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"a":1}`), 0644))
+
+	p := &FileServiceConfigProvider{Path: path, PollInterval: 10 * time.Millisecond}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := p.Watch(ctx)
+
+	assertNextConfig(t, ch, `{"a":1}`)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"a":2}`), 0644))
+	assertNextConfig(t, ch, `{"a":2}`)
+
+	cancel()
+	_, ok := <-ch
+	assert.False(t, ok, "Watch's channel must close once ctx is cancelled")
+}
+
+func TestHTTPServiceConfigProvider_Watch(t *testing.T) {
+	var body atomic.Value
+	body.Store(`{"a":1}`)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body.Load().(string)))
+	}))
+	defer srv.Close()
+
+	p := &HTTPServiceConfigProvider{URL: srv.URL, PollInterval: 10 * time.Millisecond}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := p.Watch(ctx)
+
+	assertNextConfig(t, ch, `{"a":1}`)
+
+	body.Store(`{"a":2}`)
+	assertNextConfig(t, ch, `{"a":2}`)
+}
+
+func TestHTTPServiceConfigProvider_NonOKStatusIsSkipped(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	p := &HTTPServiceConfigProvider{URL: srv.URL}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := p.Watch(ctx)
+
+	select {
+	case v, ok := <-ch:
+		t.Fatalf("expected no config push on a non-200 response, got (%q, %v)", v, ok)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func assertNextConfig(t *testing.T, ch <-chan string, expected string) {
+	t.Helper()
+
+	select {
+	case got, ok := <-ch:
+		require.True(t, ok)
+		assert.Equal(t, expected, got)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for config %q", expected)
+	}
+}